@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const checksumVersionV1 = byte(0x01)
+
+// checksumData hashes data into a stable annotation value using a canonical,
+// versioned encoding: a one-byte version tag, then for each key in sorted
+// order, varint(len(key)) || key || varint(len(digest)) || sha256(value).
+// Hashing each value's digest rather than its raw bytes keeps the canonical
+// form cheap to reuse in field-level diffs and log events (see DiffSecret)
+// without ever holding the raw secret bytes next to the hash.
+func checksumData(data map[string][]byte) string {
+	h := sha256.New()
+	h.Write([]byte{checksumVersionV1})
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, k := range sortedKeys(data) {
+		n := binary.PutUvarint(buf, uint64(len(k)))
+		h.Write(buf[:n])
+		h.Write([]byte(k))
+		digest := sha256.Sum256(data[k])
+		n = binary.PutUvarint(buf, uint64(len(digest)))
+		h.Write(buf[:n])
+		h.Write(digest[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// legacyChecksumData is the pre-canonical checksum algorithm (plain
+// key/0/value/0 hashing). checksumMatches still accepts it for one release
+// so upgrading doesn't make every existing Secret's annotation look drifted;
+// the next real data change rewrites it in the canonical form above.
+func legacyChecksumData(data map[string][]byte) string {
+	h := sha256.New()
+	for _, k := range sortedKeys(data) {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write(data[k])
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checksumMatches reports whether an existing checksum/data annotation value
+// matches data, whether it was written with the current canonical encoding
+// or the legacy one it replaced.
+func checksumMatches(existing string, data map[string][]byte) bool {
+	return existing == checksumData(data) || existing == legacyChecksumData(data)
+}
+
+func sortedKeys(data map[string][]byte) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// digestPrefixLen is how many hex characters of a value's SHA-256 are
+// surfaced in a KeyDiff — enough to distinguish a change across logs/events
+// without the value itself ever being recorded.
+const digestPrefixLen = 8
+
+func valueDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:digestPrefixLen]
+}
+
+// KeyDiff names a key that differs between a Secret's current and desired
+// data, along with a short digest of the desired value (for a removed key,
+// of its current value).
+type KeyDiff struct {
+	Key    string
+	Digest string
+}
+
+// SecretDiff is the result of comparing a Secret's current .data against a
+// desired map. Values are never included, only per-key SHA-256 prefixes, so
+// a SecretDiff is safe to log or attach to an event.
+type SecretDiff struct {
+	Added   []KeyDiff
+	Removed []KeyDiff
+	Changed []KeyDiff
+}
+
+// DiffSecret compares the live Secret namespace/name against desired and
+// reports which keys were added, removed, or changed.
+func DiffSecret(ctx context.Context, c client.Client, namespace, name string, desired map[string][]byte) (*SecretDiff, error) {
+	var s corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &s); err != nil {
+		return nil, err
+	}
+	return computeDiff(s.Data, desired), nil
+}
+
+func computeDiff(current, desired map[string][]byte) *SecretDiff {
+	diff := &SecretDiff{}
+	for _, k := range sortedKeys(desired) {
+		existing, ok := current[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, KeyDiff{Key: k, Digest: valueDigest(desired[k])})
+		case !bytes.Equal(existing, desired[k]):
+			diff.Changed = append(diff.Changed, KeyDiff{Key: k, Digest: valueDigest(desired[k])})
+		}
+	}
+	for _, k := range sortedKeys(current) {
+		if _, ok := desired[k]; !ok {
+			diff.Removed = append(diff.Removed, KeyDiff{Key: k, Digest: valueDigest(current[k])})
+		}
+	}
+	return diff
+}
+
+func diffKeys(d []KeyDiff) []string {
+	keys := make([]string, len(d))
+	for i, kd := range d {
+		keys[i] = kd.Key
+	}
+	return keys
+}
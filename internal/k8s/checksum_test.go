@@ -0,0 +1,49 @@
+package k8s
+
+import "testing"
+
+func TestChecksumMatchesAcceptsLegacyFormat(t *testing.T) {
+	data := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+
+	legacy := legacyChecksumData(data)
+	canonical := checksumData(data)
+
+	if legacy == canonical {
+		t.Fatal("legacy and canonical checksums should differ (version byte + digest-of-value encoding)")
+	}
+	if !checksumMatches(legacy, data) {
+		t.Error("checksumMatches should still accept an annotation written with the legacy algorithm")
+	}
+	if !checksumMatches(canonical, data) {
+		t.Error("checksumMatches should accept the current canonical checksum")
+	}
+
+	other := map[string][]byte{"a": []byte("1"), "b": []byte("different")}
+	if checksumMatches(legacy, other) {
+		t.Error("checksumMatches should not match a legacy checksum against changed data")
+	}
+}
+
+func TestChecksumDataDeterministic(t *testing.T) {
+	a := map[string][]byte{"x": []byte("1"), "y": []byte("2")}
+	b := map[string][]byte{"y": []byte("2"), "x": []byte("1")}
+	if checksumData(a) != checksumData(b) {
+		t.Error("checksumData should be independent of map iteration order")
+	}
+}
+
+func TestComputeDiff(t *testing.T) {
+	current := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+	desired := map[string][]byte{"a": []byte("1"), "b": []byte("changed"), "c": []byte("3")}
+
+	diff := computeDiff(current, desired)
+	if len(diff.Added) != 1 || diff.Added[0].Key != "c" {
+		t.Errorf("Added = %+v, want [c]", diff.Added)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Key != "b" {
+		t.Errorf("Changed = %+v, want [b]", diff.Changed)
+	}
+	if len(diff.Removed) != 0 {
+		t.Errorf("Removed = %+v, want []", diff.Removed)
+	}
+}
@@ -2,8 +2,6 @@ package k8s
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"reflect"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,12 +10,14 @@ import (
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // UpsertOpaqueSecret creates the Secret if missing or updates its .data if it exists.
-// - Type is always Opaque (we never mutate type on update to avoid immutability errors).
-// - Sets an owner reference to `owner` so GC cleans it up with the CR.
-// - Adds a checksum annotation for easy drift detection in diffs.
+//   - Type is always Opaque (we never mutate type on update to avoid immutability errors).
+//   - Sets an owner reference to `owner` so GC cleans it up with the CR.
+//   - Adds a checksum annotation for easy drift detection in diffs; see checksum.go
+//     for the canonical encoding and DiffSecret for field-level drift.
 func UpsertOpaqueSecret(
 	ctx context.Context,
 	c client.Client,
@@ -26,6 +26,7 @@ func UpsertOpaqueSecret(
 	owner client.Object,
 ) error {
 	sum := checksumData(data)
+	logger := log.FromContext(ctx).WithValues("namespace", namespace, "name", name)
 
 	// Try GET first.
 	var s corev1.Secret
@@ -57,10 +58,16 @@ func UpsertOpaqueSecret(
 	}
 
 	// Update path (avoid changing immutable fields like .type)
-	// Compare data to skip no-op update
-	if reflect.DeepEqual(s.Data, data) && s.Annotations["checksum/data"] == sum {
+	// Compare data to skip no-op update. checksumMatches also accepts the
+	// pre-canonical checksum format for one release, so upgrading doesn't
+	// make every existing Secret look drifted.
+	if reflect.DeepEqual(s.Data, data) && checksumMatches(s.Annotations["checksum/data"], data) {
+		logger.Info("drift=none")
 		return nil // no change
 	}
+	if diff := computeDiff(s.Data, data); len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0 {
+		logger.Info("drift detected", "added", diffKeys(diff.Added), "removed", diffKeys(diff.Removed), "changed", diffKeys(diff.Changed))
+	}
 
 	// Patch with retry for optimistic concurrency conflicts
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
@@ -80,26 +87,3 @@ func UpsertOpaqueSecret(
 		return c.Update(ctx, &s)
 	})
 }
-
-// checksumData is a small helper to annotate the Secret with a stable hash of its data.
-func checksumData(data map[string][]byte) string {
-	h := sha256.New()
-	// Deterministic hashing: iterate keys in lexical order
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
-	}
-	// simple insertion sort to avoid extra deps
-	for i := 1; i < len(keys); i++ {
-		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
-			keys[j], keys[j-1] = keys[j-1], keys[j]
-		}
-	}
-	for _, k := range keys {
-		h.Write([]byte(k))
-		h.Write([]byte{0})
-		h.Write(data[k])
-		h.Write([]byte{0})
-	}
-	return hex.EncodeToString(h.Sum(nil))
-}
@@ -0,0 +1,538 @@
+package k8s
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// SealingKeyLabel marks a Secret as a controller-owned sealing key. The value is
+// either "active" (the key new seals are produced with) or "inactive" (kept
+// around so older sealed payloads stay decryptable after rotation).
+const SealingKeyLabel = "mettlemock.io/sealing-key"
+
+const (
+	sealingKeyLabelActive   = "active"
+	sealingKeyLabelInactive = "inactive"
+)
+
+// Annotations stamped on Secrets produced by UpsertSealedSecret.
+const (
+	SealingKeyFingerprintAnnotation = "mettlemock.io/sealing-key-fingerprint"
+	SealingScopeAnnotation          = "mettlemock.io/sealing-scope"
+)
+
+// SealingScope controls how tightly a sealed value is bound to the Secret it
+// was sealed for. Tighter scopes use more of the target Secret's identity as
+// AEAD additional data, so a sealed payload can't be copied into a different
+// Secret and still decrypt.
+type SealingScope int
+
+const (
+	// ScopeCluster allows a sealed value to be unsealed into any Secret in the
+	// cluster that holds the matching key.
+	ScopeCluster SealingScope = iota
+	// ScopeNamespace binds a sealed value to the namespace it was sealed for.
+	ScopeNamespace
+	// ScopeStrict binds a sealed value to the exact namespace/name/key it was
+	// sealed for.
+	ScopeStrict
+)
+
+func (s SealingScope) String() string {
+	switch s {
+	case ScopeNamespace:
+		return "namespace"
+	case ScopeStrict:
+		return "strict"
+	default:
+		return "cluster"
+	}
+}
+
+// SealingKey is an RSA keypair used to wrap the per-value AES session keys.
+type SealingKey struct {
+	Fingerprint string
+	PrivateKey  *rsa.PrivateKey
+}
+
+// KeyRegistry stores and retrieves RSA sealing keys as controller-owned
+// Secrets in Namespace, labelled `mettlemock.io/sealing-key=active` (or
+// "inactive" once rotated out).
+type KeyRegistry struct {
+	Client    client.Client
+	Namespace string
+}
+
+// NewKeyRegistry returns a KeyRegistry backed by c, storing keys in namespace.
+func NewKeyRegistry(c client.Client, namespace string) *KeyRegistry {
+	return &KeyRegistry{Client: c, Namespace: namespace}
+}
+
+// GenerateKey creates a new 4096-bit RSA keypair, demotes any existing active
+// key to inactive (it remains decryptable via LookupKey), and persists the new
+// key as the active one.
+//
+// GenerateKey itself is not safe to call concurrently from multiple writers:
+// it is a read (list active)-then-write (create) sequence with no locking, so
+// two callers racing with no active key present can each create their own
+// active key. Rotation is expected to be driven by a single writer (e.g. a
+// leader-elected controller); concurrent callers should instead go through
+// CurrentKey, which self-heals a multi-active-key race by converging on one.
+func (r *KeyRegistry) GenerateKey(ctx context.Context) (*SealingKey, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, fmt.Errorf("generate sealing keypair: %w", err)
+	}
+	fingerprint, err := keyFingerprint(&priv.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprint sealing keypair: %w", err)
+	}
+
+	var list corev1.SecretList
+	if err := r.Client.List(ctx, &list, client.InNamespace(r.Namespace), client.MatchingLabels{SealingKeyLabel: sealingKeyLabelActive}); err != nil {
+		return nil, fmt.Errorf("list active sealing keys: %w", err)
+	}
+	for i := range list.Items {
+		s := &list.Items[i]
+		s.Labels[SealingKeyLabel] = sealingKeyLabelInactive
+		if err := r.Client.Update(ctx, s); err != nil {
+			return nil, fmt.Errorf("demote sealing key %s: %w", s.Name, err)
+		}
+	}
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sealingKeySecretName(fingerprint),
+			Namespace: r.Namespace,
+			Labels: map[string]string{
+				SealingKeyLabel: sealingKeyLabelActive,
+			},
+			Annotations: map[string]string{
+				SealingKeyFingerprintAnnotation: fingerprint,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"tls.key": pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(priv),
+			}),
+		},
+	}
+	if err := r.Client.Create(ctx, s); err != nil {
+		return nil, fmt.Errorf("create sealing key secret: %w", err)
+	}
+	return &SealingKey{Fingerprint: fingerprint, PrivateKey: priv}, nil
+}
+
+// CurrentKey returns the active sealing key, generating one if none exists
+// yet. If a race between concurrent callers left more than one Secret
+// labelled active (see GenerateKey), CurrentKey self-heals: it deterministically
+// picks the key with the lexicographically smallest name as canonical,
+// demotes the rest to inactive (they remain decryptable via LookupKey), and
+// returns the canonical one — so the registry converges on its own rather
+// than requiring manual cleanup.
+func (r *KeyRegistry) CurrentKey(ctx context.Context) (*SealingKey, error) {
+	var list corev1.SecretList
+	if err := r.Client.List(ctx, &list, client.InNamespace(r.Namespace), client.MatchingLabels{SealingKeyLabel: sealingKeyLabelActive}); err != nil {
+		return nil, fmt.Errorf("list active sealing keys: %w", err)
+	}
+	switch len(list.Items) {
+	case 0:
+		return r.GenerateKey(ctx)
+	case 1:
+		return parseSealingKeySecret(&list.Items[0])
+	default:
+		return r.reconcileActiveKeyRace(ctx, list.Items)
+	}
+}
+
+// reconcileActiveKeyRace is called when more than one Secret is labelled
+// active. It keeps the one with the lexicographically smallest name and
+// demotes the others, so repeated calls converge on a single active key
+// without any caller needing to intervene by hand.
+func (r *KeyRegistry) reconcileActiveKeyRace(ctx context.Context, items []corev1.Secret) (*SealingKey, error) {
+	canonical := &items[0]
+	for i := range items[1:] {
+		if items[i+1].Name < canonical.Name {
+			canonical = &items[i+1]
+		}
+	}
+	for i := range items {
+		if items[i].Name == canonical.Name {
+			continue
+		}
+		s := &items[i]
+		s.Labels[SealingKeyLabel] = sealingKeyLabelInactive
+		if err := r.Client.Update(ctx, s); err != nil {
+			return nil, fmt.Errorf("demote racing sealing key %s: %w", s.Name, err)
+		}
+	}
+	return parseSealingKeySecret(canonical)
+}
+
+// LookupKey returns the sealing key with the given fingerprint, active or not,
+// so that payloads sealed under a since-rotated key can still be unsealed.
+func (r *KeyRegistry) LookupKey(ctx context.Context, fingerprint string) (*SealingKey, error) {
+	var s corev1.Secret
+	key := client.ObjectKey{Namespace: r.Namespace, Name: sealingKeySecretName(fingerprint)}
+	if err := r.Client.Get(ctx, key, &s); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("sealing key %s not found: %w", fingerprint, err)
+		}
+		return nil, err
+	}
+	return parseSealingKeySecret(&s)
+}
+
+func parseSealingKeySecret(s *corev1.Secret) (*SealingKey, error) {
+	block, _ := pem.Decode(s.Data["tls.key"])
+	if block == nil {
+		return nil, fmt.Errorf("sealing key secret %s: no PEM block in tls.key", s.Name)
+	}
+	priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("sealing key secret %s: %w", s.Name, err)
+	}
+	return &SealingKey{Fingerprint: s.Annotations[SealingKeyFingerprintAnnotation], PrivateKey: priv}, nil
+}
+
+func sealingKeySecretName(fingerprint string) string {
+	return "sealing-key-" + fingerprint[:12]
+}
+
+func keyFingerprint(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SealedValue is a single encrypted value: a random AES-256-GCM session key
+// wrapped with RSA-OAEP, plus the GCM nonce and ciphertext it produced.
+type SealedValue struct {
+	EncryptedKey []byte
+	Nonce        []byte
+	Ciphertext   []byte
+}
+
+// SealedSecret is the encrypted form of a Secret's data, ready to be stored.
+type SealedSecret struct {
+	KeyFingerprint string
+	Scope          SealingScope
+	Values         map[string]SealedValue
+}
+
+// SealData encrypts data for namespace/name using the registry's current key.
+// Each value gets its own AES-256-GCM session key, RSA-OAEP wrapped under the
+// sealing key's public key. scope determines the AEAD additional data: strict
+// binds to namespace+name+key, namespace binds to namespace alone, and cluster
+// uses no additional data.
+func SealData(ctx context.Context, reg *KeyRegistry, namespace, name string, data map[string][]byte, scope SealingScope) (*SealedSecret, error) {
+	key, err := reg.CurrentKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("seal data: %w", err)
+	}
+	values := make(map[string]SealedValue, len(data))
+	for k, plaintext := range data {
+		sv, err := sealValue(&key.PrivateKey.PublicKey, plaintext, sealAAD(scope, namespace, name, k))
+		if err != nil {
+			return nil, fmt.Errorf("seal value %q: %w", k, err)
+		}
+		values[k] = *sv
+	}
+	return &SealedSecret{KeyFingerprint: key.Fingerprint, Scope: scope, Values: values}, nil
+}
+
+// UnsealSecret decrypts a SealedSecret previously produced by SealData for the
+// same namespace/name.
+func UnsealSecret(ctx context.Context, reg *KeyRegistry, namespace, name string, sealed *SealedSecret) (map[string][]byte, error) {
+	key, err := reg.LookupKey(ctx, sealed.KeyFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("unseal secret: %w", err)
+	}
+	data := make(map[string][]byte, len(sealed.Values))
+	for k, sv := range sealed.Values {
+		plaintext, err := unsealValue(key.PrivateKey, sv, sealAAD(sealed.Scope, namespace, name, k))
+		if err != nil {
+			return nil, fmt.Errorf("unseal value %q: %w", k, err)
+		}
+		data[k] = plaintext
+	}
+	return data, nil
+}
+
+func sealAAD(scope SealingScope, namespace, name, dataKey string) []byte {
+	switch scope {
+	case ScopeStrict:
+		return []byte(namespace + "/" + name + "/" + dataKey)
+	case ScopeNamespace:
+		return []byte(namespace)
+	default:
+		return nil
+	}
+}
+
+func sealValue(pub *rsa.PublicKey, plaintext, aad []byte) (*SealedValue, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, fmt.Errorf("generate session key: %w", err)
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	ciphertext := gcm.Seal(nil, nonce, plaintext, aad)
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, sessionKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrap session key: %w", err)
+	}
+	return &SealedValue{EncryptedKey: encryptedKey, Nonce: nonce, Ciphertext: ciphertext}, nil
+}
+
+func unsealValue(priv *rsa.PrivateKey, sv SealedValue, aad []byte) ([]byte, error) {
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, sv.EncryptedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap session key: %w", err)
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, sv.Nonce, sv.Ciphertext, aad)
+}
+
+// UpsertSealedSecret encrypts data with reg's current key and upserts it into
+// an Opaque Secret, storing each value as <key>.enckey, <key>.nonce and
+// <key>.ciphertext entries (see encodeSealedValues). The
+// no-op/update decision is driven by a checksum of the plaintext (see
+// checksumData), not the ciphertext, since resealing produces different
+// ciphertext (fresh nonce/session key) every time even when the plaintext is
+// unchanged.
+func UpsertSealedSecret(
+	ctx context.Context,
+	c client.Client,
+	reg *KeyRegistry,
+	namespace, name string,
+	data map[string][]byte,
+	scope SealingScope,
+	owner client.Object,
+) error {
+	sum := checksumData(data)
+
+	var existing corev1.Secret
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	err := c.Get(ctx, key, &existing)
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return err
+	}
+	if !notFound && checksumMatches(existing.Annotations["checksum/data"], data) {
+		return nil // plaintext unchanged; don't reseal or touch the Secret
+	}
+
+	sealed, err := SealData(ctx, reg, namespace, name, data, scope)
+	if err != nil {
+		return fmt.Errorf("upsert sealed secret %s/%s: %w", namespace, name, err)
+	}
+	sealedData := encodeSealedValues(sealed.Values)
+
+	annotations := map[string]string{
+		"checksum/data":                 sum,
+		SealingKeyFingerprintAnnotation: sealed.KeyFingerprint,
+		SealingScopeAnnotation:          sealed.Scope.String(),
+	}
+
+	if notFound {
+		s := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: annotations,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: sealedData,
+		}
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &s, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		return c.Create(ctx, &s)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, key, &existing); err != nil {
+			return err
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			existing.Annotations[k] = v
+		}
+		existing.Data = sealedData
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &existing, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		return c.Update(ctx, &existing)
+	})
+}
+
+// encodeSealedValue packs a single SealedValue and the fingerprint of the key
+// it was sealed with into one self-describing blob, for Sealer
+// implementations (see RegistrySealer) whose Seal/Unseal signatures carry a
+// single []byte rather than the SealedSecret struct.
+//
+// Layout: 1-byte fingerprint length || fingerprint || 4-byte big-endian
+// encrypted-key length || encrypted key || 2-byte big-endian nonce length ||
+// nonce || ciphertext (remainder).
+func encodeSealedValue(fingerprint string, sv *SealedValue) []byte {
+	out := make([]byte, 0, 1+len(fingerprint)+4+len(sv.EncryptedKey)+2+len(sv.Nonce)+len(sv.Ciphertext))
+	out = append(out, byte(len(fingerprint)))
+	out = append(out, fingerprint...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(sv.EncryptedKey)))
+	out = append(out, sv.EncryptedKey...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(sv.Nonce)))
+	out = append(out, sv.Nonce...)
+	out = append(out, sv.Ciphertext...)
+	return out
+}
+
+func decodeSealedValue(b []byte) (fingerprint string, sv SealedValue, err error) {
+	if len(b) < 1 {
+		return "", SealedValue{}, fmt.Errorf("sealed value too short")
+	}
+	fpLen := int(b[0])
+	b = b[1:]
+	if len(b) < fpLen+4 {
+		return "", SealedValue{}, fmt.Errorf("sealed value truncated (fingerprint)")
+	}
+	fingerprint = string(b[:fpLen])
+	b = b[fpLen:]
+
+	keyLen := int(binary.BigEndian.Uint32(b[:4]))
+	b = b[4:]
+	if len(b) < keyLen+2 {
+		return "", SealedValue{}, fmt.Errorf("sealed value truncated (key)")
+	}
+	sv.EncryptedKey = b[:keyLen]
+	b = b[keyLen:]
+
+	nonceLen := int(binary.BigEndian.Uint16(b[:2]))
+	b = b[2:]
+	if len(b) < nonceLen {
+		return "", SealedValue{}, fmt.Errorf("sealed value truncated (nonce)")
+	}
+	sv.Nonce = b[:nonceLen]
+	sv.Ciphertext = b[nonceLen:]
+	return fingerprint, sv, nil
+}
+
+// encodeSealedValues flattens a SealedSecret's per-key ciphertexts into a
+// Secret-compatible byte map: <key>.enckey, <key>.nonce and <key>.ciphertext.
+func encodeSealedValues(values map[string]SealedValue) map[string][]byte {
+	out := make(map[string][]byte, len(values)*3)
+	for k, sv := range values {
+		out[k+".enckey"] = sv.EncryptedKey
+		out[k+".nonce"] = sv.Nonce
+		out[k+".ciphertext"] = sv.Ciphertext
+	}
+	return out
+}
+
+// decodeSealedValues reverses encodeSealedValues, reassembling each key's
+// SealedValue from its ".enckey"/".nonce"/".ciphertext" entries.
+func decodeSealedValues(data map[string][]byte) (map[string]SealedValue, error) {
+	values := make(map[string]SealedValue)
+	for k, enckey := range data {
+		base, ok := strings.CutSuffix(k, ".enckey")
+		if !ok {
+			continue
+		}
+		nonce, ok := data[base+".nonce"]
+		if !ok {
+			return nil, fmt.Errorf("sealed secret: %q missing .nonce", base)
+		}
+		ciphertext, ok := data[base+".ciphertext"]
+		if !ok {
+			return nil, fmt.Errorf("sealed secret: %q missing .ciphertext", base)
+		}
+		values[base] = SealedValue{EncryptedKey: enckey, Nonce: nonce, Ciphertext: ciphertext}
+	}
+	return values, nil
+}
+
+// GetSealedSecret reads the Secret namespace/name written by
+// UpsertSealedSecret and reassembles it into a *SealedSecret, so callers
+// have a way to get from a stored Secret back to something UnsealSecret can
+// decrypt.
+func GetSealedSecret(ctx context.Context, c client.Client, namespace, name string) (*SealedSecret, error) {
+	var s corev1.Secret
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	if err := c.Get(ctx, key, &s); err != nil {
+		return nil, fmt.Errorf("get sealed secret %s/%s: %w", namespace, name, err)
+	}
+
+	fingerprint := s.Annotations[SealingKeyFingerprintAnnotation]
+	if fingerprint == "" {
+		return nil, fmt.Errorf("get sealed secret %s/%s: missing %s annotation", namespace, name, SealingKeyFingerprintAnnotation)
+	}
+	scope, err := parseSealingScope(s.Annotations[SealingScopeAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("get sealed secret %s/%s: %w", namespace, name, err)
+	}
+	values, err := decodeSealedValues(s.Data)
+	if err != nil {
+		return nil, fmt.Errorf("get sealed secret %s/%s: %w", namespace, name, err)
+	}
+
+	return &SealedSecret{KeyFingerprint: fingerprint, Scope: scope, Values: values}, nil
+}
+
+func parseSealingScope(s string) (SealingScope, error) {
+	switch s {
+	case "strict":
+		return ScopeStrict, nil
+	case "namespace":
+		return ScopeNamespace, nil
+	case "cluster", "":
+		return ScopeCluster, nil
+	default:
+		return 0, fmt.Errorf("unknown sealing scope %q", s)
+	}
+}
@@ -0,0 +1,182 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Sealer abstracts the backend used to encrypt Secret values, so callers can
+// swap the in-cluster RSA KeyRegistry for an external KMS (e.g. Vault
+// Transit) without changing how Secrets are upserted.
+type Sealer interface {
+	// Seal encrypts plaintext, binding it to sealCtx (typically the target
+	// Secret's namespace/name) so the ciphertext can't be replayed into a
+	// different Secret.
+	Seal(ctx context.Context, plaintext, sealCtx []byte) ([]byte, error)
+	// Unseal reverses Seal.
+	Unseal(ctx context.Context, ciphertext, sealCtx []byte) ([]byte, error)
+	// Name identifies the backend, stamped on the Secret so the right
+	// Sealer can be picked for Unseal later.
+	Name() string
+	// KeyVersion identifies the key currently used to Seal, so rewrapping on
+	// rotation is idempotent: upserts no-op once every value is sealed under
+	// the current version.
+	KeyVersion(ctx context.Context) (string, error)
+}
+
+// Annotations stamped on Secrets written via UpsertOpaqueSecretWithOptions.
+const (
+	SealedWithAnnotation       = "mettlemock.io/sealed-with"
+	SealedKeyVersionAnnotation = "mettlemock.io/sealed-key-version"
+)
+
+// RegistrySealer adapts a KeyRegistry to the Sealer interface, so the
+// in-cluster RSA keys can be used anywhere a Sealer is accepted.
+type RegistrySealer struct {
+	Registry *KeyRegistry
+}
+
+// NewRegistrySealer returns a Sealer backed by reg.
+func NewRegistrySealer(reg *KeyRegistry) *RegistrySealer {
+	return &RegistrySealer{Registry: reg}
+}
+
+func (s *RegistrySealer) Name() string { return "registry" }
+
+func (s *RegistrySealer) KeyVersion(ctx context.Context) (string, error) {
+	key, err := s.Registry.CurrentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return key.Fingerprint, nil
+}
+
+func (s *RegistrySealer) Seal(ctx context.Context, plaintext, sealCtx []byte) ([]byte, error) {
+	key, err := s.Registry.CurrentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sv, err := sealValue(&key.PrivateKey.PublicKey, plaintext, sealCtx)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSealedValue(key.Fingerprint, sv), nil
+}
+
+func (s *RegistrySealer) Unseal(ctx context.Context, ciphertext, sealCtx []byte) ([]byte, error) {
+	fingerprint, sv, err := decodeSealedValue(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.Registry.LookupKey(ctx, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return unsealValue(key.PrivateKey, sv, sealCtx)
+}
+
+// Options configures UpsertOpaqueSecretWithOptions beyond the plain
+// UpsertOpaqueSecret behaviour.
+type Options struct {
+	// Sealer, if set, wraps every value before it's written to the Secret.
+	Sealer Sealer
+}
+
+// UpsertOpaqueSecretWithOptions behaves like UpsertOpaqueSecret, but when
+// opts.Sealer is set it seals every value first and annotates the Secret with
+// the backend name and key version used, so rewrapping after key rotation is
+// idempotent: the upsert no-ops once every value is sealed under the current
+// version, and otherwise re-seals every value and replaces the Secret's
+// .data with the result.
+func UpsertOpaqueSecretWithOptions(
+	ctx context.Context,
+	c client.Client,
+	namespace, name string,
+	data map[string][]byte,
+	owner client.Object,
+	opts Options,
+) error {
+	if opts.Sealer == nil {
+		return UpsertOpaqueSecret(ctx, c, namespace, name, data, owner)
+	}
+
+	sum := checksumData(data)
+	version, err := opts.Sealer.KeyVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("upsert sealed opaque secret %s/%s: %w", namespace, name, err)
+	}
+
+	var existing corev1.Secret
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	err = c.Get(ctx, key, &existing)
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return err
+	}
+	if !notFound &&
+		checksumMatches(existing.Annotations["checksum/data"], data) &&
+		existing.Annotations[SealedWithAnnotation] == opts.Sealer.Name() &&
+		existing.Annotations[SealedKeyVersionAnnotation] == version {
+		return nil // no change, and already sealed under the current key
+	}
+
+	sealCtx := []byte(namespace + "/" + name)
+	sealedData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		ct, err := opts.Sealer.Seal(ctx, v, sealCtx)
+		if err != nil {
+			return fmt.Errorf("seal %q: %w", k, err)
+		}
+		sealedData[k] = ct
+	}
+
+	annotations := map[string]string{
+		"checksum/data":            sum,
+		SealedWithAnnotation:       opts.Sealer.Name(),
+		SealedKeyVersionAnnotation: version,
+	}
+
+	if notFound {
+		s := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: annotations,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: sealedData,
+		}
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &s, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		return c.Create(ctx, &s)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, key, &existing); err != nil {
+			return err
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			existing.Annotations[k] = v
+		}
+		existing.Data = sealedData
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &existing, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		return c.Update(ctx, &existing)
+	})
+}
@@ -0,0 +1,48 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+)
+
+// FakeSealer is an in-memory Sealer for tests: it "seals" by prefixing the
+// sealCtx and a version marker onto the plaintext, and refuses to unseal
+// ciphertext sealed under a different context or with the wrong version.
+// It is not cryptographically meaningful and must never be used outside
+// tests.
+type FakeSealer struct {
+	// Version is returned by KeyVersion; defaults to "v1" if empty.
+	Version string
+}
+
+func (f *FakeSealer) Name() string { return "fake" }
+
+func (f *FakeSealer) version() string {
+	if f.Version != "" {
+		return f.Version
+	}
+	return "v1"
+}
+
+func (f *FakeSealer) KeyVersion(ctx context.Context) (string, error) {
+	return f.version(), nil
+}
+
+func (f *FakeSealer) Seal(ctx context.Context, plaintext, sealCtx []byte) ([]byte, error) {
+	header := []byte(fmt.Sprintf("fake:%s:%d:", f.version(), len(sealCtx)))
+	out := append(header, sealCtx...)
+	out = append(out, plaintext...)
+	return out, nil
+}
+
+func (f *FakeSealer) Unseal(ctx context.Context, ciphertext, sealCtx []byte) ([]byte, error) {
+	header := []byte(fmt.Sprintf("fake:%s:%d:", f.version(), len(sealCtx)))
+	if len(ciphertext) < len(header) || string(ciphertext[:len(header)]) != string(header) {
+		return nil, fmt.Errorf("fake seal: bad header or key version")
+	}
+	rest := ciphertext[len(header):]
+	if len(rest) < len(sealCtx) || string(rest[:len(sealCtx)]) != string(sealCtx) {
+		return nil, fmt.Errorf("fake seal: context mismatch")
+	}
+	return rest[len(sealCtx):], nil
+}
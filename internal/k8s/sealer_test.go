@@ -0,0 +1,202 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestFakeSealerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := &FakeSealer{}
+
+	ct, err := s.Seal(ctx, []byte("plaintext"), []byte("ns/name"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	pt, err := s.Unseal(ctx, ct, []byte("ns/name"))
+	if err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if string(pt) != "plaintext" {
+		t.Errorf("got %q, want %q", pt, "plaintext")
+	}
+
+	if _, err := s.Unseal(ctx, ct, []byte("other/name")); err == nil {
+		t.Error("Unseal succeeded with a mismatched sealCtx")
+	}
+}
+
+func TestRegistrySealerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+	sealer := NewRegistrySealer(NewKeyRegistry(c, "mettlemock-system"))
+
+	ct, err := sealer.Seal(ctx, []byte("plaintext"), []byte("apps/db-creds"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	pt, err := sealer.Unseal(ctx, ct, []byte("apps/db-creds"))
+	if err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if string(pt) != "plaintext" {
+		t.Errorf("got %q, want %q", pt, "plaintext")
+	}
+
+	if _, err := sealer.Unseal(ctx, ct, []byte("apps/other-secret")); err == nil {
+		t.Error("Unseal succeeded with a mismatched sealCtx")
+	}
+}
+
+// TestVaultSealerRetriesOnServerError verifies the exponential-backoff retry
+// loop recovers from transient 5xx/429 responses instead of failing the
+// first time Vault hiccups.
+func TestVaultSealerRetriesOnServerError(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]string{"ciphertext": "vault:v1:ZmFrZQ=="},
+		})
+	}))
+	defer srv.Close()
+
+	v := &VaultSealer{Address: srv.URL, Key: "mettlemock"}
+	ct, err := v.Seal(context.Background(), []byte("plaintext"), []byte("apps/db-creds"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if string(ct) != "vault:v1:ZmFrZQ==" {
+		t.Errorf("got %q", ct)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts (2 failures + 1 success), got %d", attempts)
+	}
+}
+
+// TestVaultSealerGivesUpAfterMaxRetries verifies a persistently failing
+// backend eventually surfaces an error instead of retrying forever.
+func TestVaultSealerGivesUpAfterMaxRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	v := &VaultSealer{Address: srv.URL, Key: "mettlemock", MaxRetries: 2}
+	if _, err := v.Seal(context.Background(), []byte("plaintext"), []byte("apps/db-creds")); err == nil {
+		t.Error("expected Seal to fail after exhausting retries")
+	}
+}
+
+func TestUpsertOpaqueSecretWithOptionsSealsOnCreate(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+	sealer := &FakeSealer{}
+
+	data := map[string][]byte{"password": []byte("hunter2")}
+	if err := UpsertOpaqueSecretWithOptions(ctx, c, "apps", "db-creds", data, nil, Options{Sealer: sealer}); err != nil {
+		t.Fatalf("UpsertOpaqueSecretWithOptions: %v", err)
+	}
+
+	var s corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "db-creds"}, &s); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(s.Data["password"]) == "hunter2" {
+		t.Error("value was stored in plaintext, expected it to be sealed")
+	}
+	if s.Annotations[SealedWithAnnotation] != sealer.Name() {
+		t.Errorf("SealedWithAnnotation = %q, want %q", s.Annotations[SealedWithAnnotation], sealer.Name())
+	}
+	if s.Annotations[SealedKeyVersionAnnotation] != "v1" {
+		t.Errorf("SealedKeyVersionAnnotation = %q, want %q", s.Annotations[SealedKeyVersionAnnotation], "v1")
+	}
+
+	sealCtx := []byte("apps/db-creds")
+	got, err := sealer.Unseal(ctx, s.Data["password"], sealCtx)
+	if err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if string(got) != "hunter2" {
+		t.Errorf("got %q, want %q", got, "hunter2")
+	}
+}
+
+func TestUpsertOpaqueSecretWithOptionsNoopWhenAlreadySealedUnderCurrentVersion(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+	sealer := &FakeSealer{}
+
+	data := map[string][]byte{"password": []byte("hunter2")}
+	if err := UpsertOpaqueSecretWithOptions(ctx, c, "apps", "db-creds", data, nil, Options{Sealer: sealer}); err != nil {
+		t.Fatalf("initial UpsertOpaqueSecretWithOptions: %v", err)
+	}
+
+	var before corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "db-creds"}, &before); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+
+	if err := UpsertOpaqueSecretWithOptions(ctx, c, "apps", "db-creds", data, nil, Options{Sealer: sealer}); err != nil {
+		t.Fatalf("second UpsertOpaqueSecretWithOptions: %v", err)
+	}
+
+	var after corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "db-creds"}, &after); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(after.Data["password"]) != string(before.Data["password"]) {
+		t.Error("no-op upsert re-sealed the value, changing its ciphertext")
+	}
+}
+
+func TestUpsertOpaqueSecretWithOptionsRewrapsOnKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+	sealer := &FakeSealer{}
+
+	data := map[string][]byte{"password": []byte("hunter2")}
+	if err := UpsertOpaqueSecretWithOptions(ctx, c, "apps", "db-creds", data, nil, Options{Sealer: sealer}); err != nil {
+		t.Fatalf("initial UpsertOpaqueSecretWithOptions: %v", err)
+	}
+
+	var before corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "db-creds"}, &before); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+
+	sealer.Version = "v2"
+	if err := UpsertOpaqueSecretWithOptions(ctx, c, "apps", "db-creds", data, nil, Options{Sealer: sealer}); err != nil {
+		t.Fatalf("rewrap UpsertOpaqueSecretWithOptions: %v", err)
+	}
+
+	var after corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "db-creds"}, &after); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if after.Annotations[SealedKeyVersionAnnotation] != "v2" {
+		t.Errorf("SealedKeyVersionAnnotation = %q, want %q", after.Annotations[SealedKeyVersionAnnotation], "v2")
+	}
+	if string(after.Data["password"]) == string(before.Data["password"]) {
+		t.Error("expected the value to be re-sealed under the rotated key version")
+	}
+
+	got, err := sealer.Unseal(ctx, after.Data["password"], []byte("apps/db-creds"))
+	if err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if string(got) != "hunter2" {
+		t.Errorf("got %q, want %q", got, "hunter2")
+	}
+}
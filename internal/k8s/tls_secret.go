@@ -0,0 +1,195 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Annotations stamped on Secrets written by UpsertTLSSecret.
+const (
+	CertNotBeforeAnnotation = "mettlemock.io/certificate-not-before"
+	CertNotAfterAnnotation  = "mettlemock.io/certificate-not-after"
+	ChecksumCertAnnotation  = "checksum/cert"
+)
+
+// TLSSecretOptions configures UpsertTLSSecret.
+type TLSSecretOptions struct {
+	// ForceRotate allows overwriting a certificate that hasn't expired yet.
+	// Without it, UpsertTLSSecret refuses to replace cert/key content while
+	// the currently-stored certificate is still valid, so a rotation
+	// controller racing ahead of schedule can't clobber a good cert.
+	ForceRotate bool
+}
+
+// UpsertTLSSecret creates or updates a `kubernetes.io/tls` Secret from a
+// PEM-encoded cert/key pair. It stamps `certificate-not-before` /
+// `certificate-not-after` annotations from the leaf certificate and a
+// `checksum/cert` annotation over its DER bytes.
+//
+// Unlike UpsertOpaqueSecret, a content change here is a cert rotation: if the
+// currently-stored certificate is not yet expired, UpsertTLSSecret refuses to
+// overwrite it unless opts.ForceRotate is set. And when the certificate
+// content is unchanged but its annotations or controller owner reference have
+// drifted (labels are not compared or set),
+// it takes an update-only, metadata-only patch path rather than rewriting
+// .data — so a rotation controller reconciling for unrelated reasons never
+// touches (and never risks deleting/recreating) the Secret consumers mount.
+func UpsertTLSSecret(
+	ctx context.Context,
+	c client.Client,
+	namespace, name string,
+	certPEM, keyPEM []byte,
+	owner client.Object,
+	opts TLSSecretOptions,
+) error {
+	cert, err := parseLeafCertificate(certPEM)
+	if err != nil {
+		return fmt.Errorf("upsert tls secret %s/%s: %w", namespace, name, err)
+	}
+
+	desiredAnnotations := map[string]string{
+		"checksum/data":         checksumData(map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}),
+		ChecksumCertAnnotation:  checksumBytes(cert.Raw),
+		CertNotBeforeAnnotation: cert.NotBefore.UTC().Format(time.RFC3339),
+		CertNotAfterAnnotation:  cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+	}
+
+	var existing corev1.Secret
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	err = c.Get(ctx, key, &existing)
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return err
+	}
+
+	if notFound {
+		s := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: desiredAnnotations,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &s, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		return c.Create(ctx, &s)
+	}
+
+	sameCert := existing.Annotations[ChecksumCertAnnotation] == desiredAnnotations[ChecksumCertAnnotation]
+	if !sameCert {
+		if notAfter, ok := parseCurrentNotAfter(&existing); ok && time.Now().Before(notAfter) && !opts.ForceRotate {
+			return fmt.Errorf("refusing to rotate tls secret %s/%s: current certificate is valid until %s (set ForceRotate to override)",
+				namespace, name, notAfter.Format(time.RFC3339))
+		}
+	}
+
+	// sameData covers the full cert+key payload, unlike sameCert above which
+	// only covers the cert's DER bytes — a key-only change must still trigger
+	// a data rewrite even though it leaves sameCert true.
+	sameData := checksumMatches(existing.Annotations["checksum/data"], data)
+	metadataDrift := !annotationsMatch(existing.Annotations, desiredAnnotations) || (owner != nil && !hasControllerRef(&existing, owner))
+	if sameData && !metadataDrift {
+		return nil // no-op: cert/key content and metadata both already match
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, key, &existing); err != nil {
+			return err
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		for k, v := range desiredAnnotations {
+			existing.Annotations[k] = v
+		}
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, &existing, c.Scheme()); err != nil {
+				return err
+			}
+		}
+		if !sameData {
+			// A real content change (cert and/or key): replace stored data.
+			existing.Data = data
+		}
+		// else: update-only path — metadata changed, data didn't, so .Data is
+		// left exactly as it is on the server and never touched.
+		return c.Update(ctx, &existing)
+	})
+}
+
+func parseLeafCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parseCurrentNotAfter reports the expiry of the certificate actually stored
+// in s. The annotation is not trusted as the source of truth here: it can be
+// missing or stale if the Secret was created by another path, or edited
+// directly, and trusting it blindly would skip the not-yet-expired guard
+// entirely. It's only consulted as a fallback when s.Data has no parseable
+// certificate to read NotAfter from.
+func parseCurrentNotAfter(s *corev1.Secret) (time.Time, bool) {
+	if certPEM, ok := s.Data[corev1.TLSCertKey]; ok {
+		if cert, err := parseLeafCertificate(certPEM); err == nil {
+			return cert.NotAfter, true
+		}
+	}
+	v, ok := s.Annotations[CertNotAfterAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func annotationsMatch(existing, desired map[string]string) bool {
+	for k, v := range desired {
+		if existing[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func hasControllerRef(obj metav1.Object, owner client.Object) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() && ref.Controller != nil && *ref.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumBytes hashes raw bytes directly, for annotations like
+// checksum/cert that cover a single DER blob rather than a key/value map.
+func checksumBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
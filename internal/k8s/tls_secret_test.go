@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// generateTestCert returns a self-signed cert/key PEM pair valid for
+// [notBefore, notAfter), for exercising UpsertTLSSecret's expiry logic.
+func generateTestCert(t *testing.T, notBefore, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return certPEM, keyPEM
+}
+
+func TestUpsertTLSSecretRefusesPrematureRotation(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+
+	oldCert, oldKey := generateTestCert(t, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", oldCert, oldKey, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("initial UpsertTLSSecret: %v", err)
+	}
+
+	newCert, newKey := generateTestCert(t, time.Now(), time.Now().Add(48*time.Hour))
+	err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", newCert, newKey, nil, TLSSecretOptions{})
+	if err == nil {
+		t.Fatal("expected UpsertTLSSecret to refuse rotating a not-yet-expired certificate")
+	}
+
+	var s corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "serving-cert"}, &s); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(s.Data[corev1.TLSCertKey]) != string(oldCert) {
+		t.Error("stored certificate changed despite the refusal")
+	}
+}
+
+func TestUpsertTLSSecretForceRotateOverrides(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+
+	oldCert, oldKey := generateTestCert(t, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", oldCert, oldKey, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("initial UpsertTLSSecret: %v", err)
+	}
+
+	newCert, newKey := generateTestCert(t, time.Now(), time.Now().Add(48*time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", newCert, newKey, nil, TLSSecretOptions{ForceRotate: true}); err != nil {
+		t.Fatalf("UpsertTLSSecret with ForceRotate: %v", err)
+	}
+
+	var s corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "serving-cert"}, &s); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(s.Data[corev1.TLSCertKey]) != string(newCert) {
+		t.Error("ForceRotate did not replace the stored certificate")
+	}
+}
+
+func TestUpsertTLSSecretAllowsRotationAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+
+	expiredCert, expiredKey := generateTestCert(t, time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", expiredCert, expiredKey, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("initial UpsertTLSSecret: %v", err)
+	}
+
+	newCert, newKey := generateTestCert(t, time.Now(), time.Now().Add(48*time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", newCert, newKey, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("expected rotation of an expired certificate to be allowed without ForceRotate: %v", err)
+	}
+}
+
+func TestUpsertTLSSecretMetadataOnlyPatchLeavesDataAlone(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(t)
+
+	certPEM, keyPEM := generateTestCert(t, time.Now(), time.Now().Add(24*time.Hour))
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", certPEM, keyPEM, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("initial UpsertTLSSecret: %v", err)
+	}
+
+	var s corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "serving-cert"}, &s); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	delete(s.Annotations, CertNotBeforeAnnotation)
+	if err := c.Update(ctx, &s); err != nil {
+		t.Fatalf("simulate annotation drift: %v", err)
+	}
+
+	if err := UpsertTLSSecret(ctx, c, "apps", "serving-cert", certPEM, keyPEM, nil, TLSSecretOptions{}); err != nil {
+		t.Fatalf("metadata-only UpsertTLSSecret: %v", err)
+	}
+
+	var patched corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "serving-cert"}, &patched); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if patched.Annotations[CertNotBeforeAnnotation] == "" {
+		t.Error("expected the dropped certificate-not-before annotation to be restored")
+	}
+	if string(patched.Data[corev1.TLSCertKey]) != string(certPEM) {
+		t.Error("metadata-only patch must not touch stored certificate data")
+	}
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultSealer is a Sealer backed by HashiCorp Vault's Transit secrets engine.
+// It calls transit/encrypt/<Key> and transit/decrypt/<Key>, using a base64
+// context derived from the target Secret's namespace/name for Vault's
+// "derived key" / convergent-encryption context parameter.
+type VaultSealer struct {
+	// Address is the Vault base URL, e.g. "https://vault.example.com:8200".
+	Address string
+	// MountPath is the Transit engine's mount, defaulting to "transit" if empty.
+	MountPath string
+	// Key is the name of the transit key to encrypt/decrypt with.
+	Key string
+	// Token is the Vault token used to authenticate requests.
+	Token string
+
+	// HTTPClient is used for requests; defaults to http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// MaxRetries bounds the exponential-backoff retry loop on 5xx/429
+	// responses; defaults to 5 if zero.
+	MaxRetries int
+}
+
+func (v *VaultSealer) Name() string { return "vault-transit:" + v.Key }
+
+// KeyVersion returns the transit key's current version, so rewrapping after
+// Vault-side key rotation is detected the same way RegistrySealer detects
+// RSA key rotation.
+func (v *VaultSealer) KeyVersion(ctx context.Context) (string, error) {
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, v.mountPath()+"/keys/"+v.Key, nil, &resp); err != nil {
+		return "", fmt.Errorf("vault transit key version: %w", err)
+	}
+	return fmt.Sprintf("%d", resp.Data.LatestVersion), nil
+}
+
+func (v *VaultSealer) Seal(ctx context.Context, plaintext, sealCtx []byte) ([]byte, error) {
+	req := map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		"context":   base64.StdEncoding.EncodeToString(sealCtx),
+	}
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodPost, v.mountPath()+"/encrypt/"+v.Key, req, &resp); err != nil {
+		return nil, fmt.Errorf("vault transit encrypt: %w", err)
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (v *VaultSealer) Unseal(ctx context.Context, ciphertext, sealCtx []byte) ([]byte, error) {
+	req := map[string]string{
+		"ciphertext": string(ciphertext),
+		"context":    base64.StdEncoding.EncodeToString(sealCtx),
+	}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodPost, v.mountPath()+"/decrypt/"+v.Key, req, &resp); err != nil {
+		return nil, fmt.Errorf("vault transit decrypt: %w", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("vault transit decrypt: decode plaintext: %w", err)
+	}
+	return plaintext, nil
+}
+
+func (v *VaultSealer) mountPath() string {
+	if v.MountPath != "" {
+		return v.MountPath
+	}
+	return "transit"
+}
+
+func (v *VaultSealer) httpClient() *http.Client {
+	if v.HTTPClient != nil {
+		return v.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (v *VaultSealer) maxRetries() int {
+	if v.MaxRetries != 0 {
+		return v.MaxRetries
+	}
+	return 5
+}
+
+// do issues a Vault API request, retrying with exponential backoff on 5xx
+// and 429 (rate-limited) responses.
+func (v *VaultSealer) do(ctx context.Context, method, path string, body any, out any) error {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	url := strings.TrimRight(v.Address, "/") + "/v1/" + path
+
+	var lastErr error
+	for attempt := 0; attempt <= v.maxRetries(); attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Vault-Token", v.Token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := v.httpClient().Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("vault request failed with status %d: %s", resp.StatusCode, string(respBody))
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("vault request failed with status %d: %s", resp.StatusCode, string(respBody))
+		}
+
+		if out == nil || len(respBody) == 0 {
+			return nil
+		}
+		return json.Unmarshal(respBody, out)
+	}
+	return fmt.Errorf("vault request exhausted %d retries: %w", v.maxRetries(), lastErr)
+}